@@ -6,17 +6,22 @@ import (
 	"fmt"
 	"net/http"
 	netpprof "net/http/pprof"
+	"net/url"
 	"os"
 	"os/signal"
 	"reflect"
 	"runtime/pprof"
+	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/gofiber/adaptor/v2"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/filesystem"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"go.uber.org/zap"
@@ -24,6 +29,9 @@ import (
 	"github.com/deflix-tv/go-stremio/pkg/cinemeta"
 )
 
+// Docker stop only gives us 10s. We want to close all connections and flush metrics before that.
+const shutdownGracePeriod = 9 * time.Second
+
 // ManifestCallback is the callback for manifest requests, so mostly addon installations.
 // You can use the callback for two things:
 //  1. To *prevent* users from installing your addon in Stremio.
@@ -37,8 +45,19 @@ import (
 //     Note that the manifest is only returned if the first return value is < 400 (see point 1.).
 type ManifestCallback func(ctx context.Context, manifest *Manifest, userData interface{}) int
 
+// StartCallback is the callback that's called once after the server's listener is bound.
+// You can use it for slow initializations like warming up caches.
+// The context is cancelled when the addon receives a shutdown signal, so a long-running warmup should respect it.
+// Until it returns, requests to the catalog, stream and meta endpoints are answered with "503 Service Unavailable",
+// while requests to the manifest and health endpoints are handled as usual, so that addon installations succeed during a slow startup.
+// If it returns an error, the addon logs it and exits.
+type StartCallback func(ctx context.Context) error
+
 // CatalogHandler is the callback for catalog requests for a specific type (like "movie").
 // The id parameter is the catalog ID that you specified yourself in the CatalogItem objects in the Manifest.
+// Extra parameters like "skip" or "genre" can be fetched via GetCatalogExtraFromContext(ctx).
+// When a PreviewResolver is set in the options, you can return items with only the ID set and the SDK fills in the rest.
+// For cursor-based pagination you can return the cursor for the next page via SetNextCatalogCursor(ctx, cursor).
 // The userData parameter depends on whether you called `RegisterUserData()` before:
 // If not, a simple string will be passed. It's empty if the user didn't provide user data.
 // If yes, a pointer to an object you registered will be passed. It's nil if the user didn't provide user data.
@@ -57,9 +76,10 @@ type MetaHandler func(ctx context.Context, id string, userData interface{}) (Met
 
 // MetaFetcher returns metadata for movies and TV shows.
 // It's used when you configure that the media name should be logged or that metadata should be put into the context.
+// The lang parameter is the ISO 639-1 code of the first language in the client's "Accept-Language" header (like "de"), or "en" if the header is missing or invalid.
 type MetaFetcher interface {
-	GetMovie(ctx context.Context, imdbID string) (cinemeta.Meta, error)
-	GetTVShow(ctx context.Context, imdbID string, season int, episode int) (cinemeta.Meta, error)
+	GetMovie(ctx context.Context, imdbID string, lang string) (cinemeta.Meta, error)
+	GetTVShow(ctx context.Context, imdbID string, season int, episode int, lang string) (cinemeta.Meta, error)
 }
 
 // Addon represents a remote addon.
@@ -74,8 +94,13 @@ type Addon struct {
 	customMiddlewares []customMiddleware
 	customEndpoints   []customEndpoint
 	manifestCallback  ManifestCallback
+	startCallback     StartCallback
+	ready             int32 // Accessed atomically. 1 means ready.
+	stopChan          chan struct{}
+	stopOnce          *sync.Once
 	userDataType      reflect.Type
 	metaClient        MetaFetcher
+	clientIP          func(*fiber.Ctx) string
 }
 
 // NewAddon creates a new Addon object that can be started with Run().
@@ -90,6 +115,8 @@ func NewAddon(manifest Manifest, catalogHandlers map[string]CatalogHandler, stre
 		(opts.CachePublicMeta && opts.CacheAgeMeta == 0) ||
 		(opts.CachePublicStreams && opts.CacheAgeStreams == 0) {
 		return nil, errors.New("Enabling public caching only makes sense when also setting a cache age")
+	} else if opts.CacheAgeEmptyStreams != 0 && opts.CacheAgeEmptyStreams >= opts.CacheAgeStreams && opts.CacheAgeStreams != 0 {
+		return nil, errors.New("A cache age for empty stream results only makes sense when it's shorter than the cache age for streams")
 	} else if (opts.HandleEtagCatalogs && opts.CacheAgeCatalogs == 0) ||
 		(opts.HandleEtagStreams && opts.CacheAgeStreams == 0) {
 		return nil, errors.New("ETag handling only makes sense when also setting a cache age")
@@ -103,6 +130,22 @@ func NewAddon(manifest Manifest, catalogHandlers map[string]CatalogHandler, stre
 		return nil, errors.New("Setting a meta client when neither logging the media name nor putting it in the context doesn't make sense")
 	} else if opts.MetaClient != nil && opts.CinemetaTimeout != 0 {
 		return nil, errors.New("Setting a Cinemeta timeout doesn't make sense when you already set a meta client")
+	} else if opts.MaxConcurrentStreams < 0 || opts.MaxConcurrentStreamsPerIP < 0 {
+		return nil, errors.New("Concurrent stream limits must not be negative")
+	} else if opts.MaxConcurrentStreams != 0 && opts.MaxConcurrentStreamsPerIP > opts.MaxConcurrentStreams {
+		return nil, errors.New("A per-IP concurrent stream limit that's higher than the global one doesn't make sense")
+	} else if opts.PreviewResolver != nil && catalogHandlers == nil {
+		return nil, errors.New("Setting a preview resolver only makes sense when also passing catalog handlers")
+	} else if opts.PreviewCacheTTL != 0 && opts.PreviewResolver == nil {
+		return nil, errors.New("Setting a preview cache TTL only makes sense when also setting a preview resolver")
+	} else if opts.MetricsFlush != nil && !opts.Metrics {
+		return nil, errors.New("Setting a metrics flush function only makes sense when also enabling metrics")
+	} else if opts.CompressLevel != CompressLevelDefault && !opts.Compression {
+		return nil, errors.New("Setting a compression level only makes sense when also enabling compression")
+	} else if opts.CompressLevel < CompressLevelDefault || opts.CompressLevel > CompressLevelBestCompression {
+		return nil, errors.New("Unknown compression level")
+	} else if len(opts.TrustedProxies) > 0 && opts.ProxyHeader == "" {
+		return nil, errors.New("Setting trusted proxies only makes sense when also setting a proxy header")
 	} else if manifest.BehaviorHints.ConfigurationRequired && !manifest.BehaviorHints.Configurable {
 		return nil, errors.New("Requiring a configuration only makes sense when also making the addon configurable")
 	} else if opts.ConfigureHTMLfs != nil && !manifest.BehaviorHints.Configurable {
@@ -126,10 +169,24 @@ func NewAddon(manifest Manifest, catalogHandlers map[string]CatalogHandler, stre
 	if opts.CinemetaTimeout == 0 {
 		opts.CinemetaTimeout = DefaultOptions.CinemetaTimeout
 	}
+	if opts.JSONContentType == "" {
+		opts.JSONContentType = DefaultOptions.JSONContentType
+	}
+	if opts.PreviewResolver != nil && opts.PreviewCacheTTL == 0 {
+		opts.PreviewCacheTTL = DefaultOptions.PreviewCacheTTL
+	}
+	if opts.CatalogCursorTTL == 0 {
+		opts.CatalogCursorTTL = DefaultOptions.CatalogCursorTTL
+	}
+
+	// Client IP for logging and the per-IP stream limit
+	clientIP, err := newClientIPFunc(opts.ProxyHeader, opts.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't parse trusted proxies: %w", err)
+	}
 
 	// Configure logger if no custom one is set
 	if opts.Logger == nil {
-		var err error
 		if opts.Logger, err = NewLogger(opts.LoggingLevel, opts.LogEncoding); err != nil {
 			return nil, fmt.Errorf("Couldn't create new logger: %w", err)
 		}
@@ -152,6 +209,10 @@ func NewAddon(manifest Manifest, catalogHandlers map[string]CatalogHandler, stre
 		opts:            opts,
 		logger:          opts.Logger,
 		metaClient:      opts.MetaClient,
+		clientIP:        clientIP,
+		ready:           1,
+		stopChan:        make(chan struct{}),
+		stopOnce:        &sync.Once{},
 	}, nil
 }
 
@@ -205,9 +266,101 @@ func (a *Addon) SetManifestCallback(callback ManifestCallback) {
 	a.manifestCallback = callback
 }
 
+// SetStartCallback sets the start callback
+func (a *Addon) SetStartCallback(callback StartCallback) {
+	a.startCallback = callback
+}
+
+func (a *Addon) setReady(ready bool) {
+	var val int32
+	if ready {
+		val = 1
+	}
+	atomic.StoreInt32(&a.ready, val)
+}
+
+func (a *Addon) isReady() bool {
+	return atomic.LoadInt32(&a.ready) == 1
+}
+
+// effectiveConfigFields returns zap fields that summarize the effective configuration of the addon, so that a single log line is enough to verify a deployment.
+// Values that could contain secrets (like credentials in the redirect URL) are redacted.
+func (a *Addon) effectiveConfigFields(addr string) []zap.Field {
+	var resources []string
+	if a.catalogHandlers != nil {
+		resources = append(resources, "catalog")
+	}
+	if a.metaHandlers != nil {
+		resources = append(resources, "meta")
+	}
+	if a.streamHandlers != nil {
+		resources = append(resources, "stream")
+	}
+	catalogIDs := make([]string, len(a.manifest.Catalogs))
+	for i, catalog := range a.manifest.Catalogs {
+		catalogIDs[i] = catalog.Type + "/" + catalog.ID
+	}
+	_, isCinemeta := a.metaClient.(*cinemeta.Client)
+	redirectURL := a.opts.RedirectURL
+	if u, err := url.Parse(redirectURL); err == nil {
+		redirectURL = u.Redacted()
+	}
+
+	return []zap.Field{
+		zap.String("address", addr),
+		zap.String("addonID", a.manifest.ID),
+		zap.String("version", a.manifest.Version),
+		zap.Strings("resources", resources),
+		zap.Strings("catalogTypes", handlerTypes(a.catalogHandlers)),
+		zap.Strings("metaTypes", handlerTypes(a.metaHandlers)),
+		zap.Strings("streamTypes", handlerTypes(a.streamHandlers)),
+		zap.Strings("catalogIDs", catalogIDs),
+		zap.Duration("cacheAgeCatalogs", a.opts.CacheAgeCatalogs),
+		zap.Duration("cacheAgeMeta", a.opts.CacheAgeMeta),
+		zap.Duration("cacheAgeStreams", a.opts.CacheAgeStreams),
+		zap.Duration("cacheAgeEmptyStreams", a.opts.CacheAgeEmptyStreams),
+		zap.Bool("cachePublicCatalogs", a.opts.CachePublicCatalogs),
+		zap.Bool("cachePublicMeta", a.opts.CachePublicMeta),
+		zap.Bool("cachePublicStreams", a.opts.CachePublicStreams),
+		zap.Bool("handleEtagCatalogs", a.opts.HandleEtagCatalogs),
+		zap.Bool("handleEtagMeta", a.opts.HandleEtagMeta),
+		zap.Bool("handleEtagStreams", a.opts.HandleEtagStreams),
+		zap.Int("maxConcurrentStreams", a.opts.MaxConcurrentStreams),
+		zap.Int("maxConcurrentStreamsPerIP", a.opts.MaxConcurrentStreamsPerIP),
+		zap.String("proxyHeader", a.opts.ProxyHeader),
+		zap.Strings("trustedProxies", a.opts.TrustedProxies),
+		zap.Bool("cinemeta", isCinemeta),
+		zap.Duration("cinemetaTimeout", a.opts.CinemetaTimeout),
+		zap.Bool("previewResolver", a.opts.PreviewResolver != nil),
+		zap.Duration("previewCacheTTL", a.opts.PreviewCacheTTL),
+		zap.Bool("customMetaClient", a.metaClient != nil && !isCinemeta),
+		zap.Bool("configurable", a.manifest.BehaviorHints.Configurable),
+		zap.Bool("configurationRequired", a.manifest.BehaviorHints.ConfigurationRequired),
+		zap.Bool("requestLogging", !a.opts.DisableRequestLogging),
+		zap.Bool("profiling", a.opts.Profiling),
+		zap.Bool("metrics", a.opts.Metrics),
+		zap.Bool("metricsFlush", a.opts.MetricsFlush != nil),
+		zap.String("jsonContentType", a.opts.JSONContentType),
+		zap.Bool("compression", a.opts.Compression),
+		zap.Stringer("compressLevel", a.opts.CompressLevel),
+		zap.String("redirectURL", redirectURL),
+	}
+}
+
+// handlerTypes returns the sorted types for which a handler is registered.
+func handlerTypes(handlers interface{}) []string {
+	v := reflect.ValueOf(handlers)
+	types := make([]string, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		types = append(types, k.String())
+	}
+	sort.Strings(types)
+	return types
+}
+
 // Run starts the remote addon. It sets up an HTTP server that handles requests to "/manifest.json" etc. and gracefully handles shutdowns.
 // The call is *blocking*, so use the stoppingChan param if you want to be notified when the addon is about to shut down
-// because of a system signal like Ctrl+C or `docker stop`. It should be a buffered channel with a capacity of 1.
+// because of a system signal like Ctrl+C or `docker stop` or a call to Stop(). It should be a buffered channel with a capacity of 1.
 func (a *Addon) Run(stoppingChan chan bool) {
 	logger := a.logger
 	defer logger.Sync()
@@ -217,30 +370,138 @@ func (a *Addon) Run(stoppingChan chan bool) {
 		logger.Fatal("The passed stopping channel isn't buffered")
 	}
 
-	// Fiber app
+	// Only report readiness once the start callback finished
+	a.setReady(a.startCallback == nil)
 
 	logger.Info("Setting up server...")
+	app := a.createApp()
+	logger.Info("Finished setting up server")
+
+	stopping := false
+	stoppingPtr := &stopping
+
+	// Cancelled when receiving a shutdown signal, so that a slow start callback doesn't keep running during the shutdown
+	startCtx, cancelStart := context.WithCancel(context.Background())
+	defer cancelStart()
+	if a.startCallback != nil {
+		// Only call the start callback once the listener is bound
+		app.Hooks().OnListen(func() error {
+			go func() {
+				logger.Info("Calling start callback...")
+				if err := a.startCallback(startCtx); err != nil {
+					if startCtx.Err() != nil {
+						logger.Warn("Start callback was cancelled due to the shutdown", zap.Error(err))
+						return
+					}
+					logger.Fatal("Start callback returned an error", zap.Error(err))
+				}
+				a.setReady(true)
+				logger.Info("Start callback finished, addon is ready")
+			}()
+			return nil
+		})
+	}
+
+	addr := a.opts.BindAddr + ":" + strconv.Itoa(a.opts.Port)
+	logger.Info("Starting server", a.effectiveConfigFields(addr)...)
+	go func() {
+		if err := app.Listen(addr); err != nil {
+			if !*stoppingPtr {
+				logger.Fatal("Couldn't start server", zap.Error(err))
+			} else {
+				logger.Fatal("Error in srv.ListenAndServe() during server shutdown (probably context deadline expired before the server could shutdown cleanly)", zap.Error(err))
+			}
+		}
+	}()
+
+	// Graceful shutdown
+
+	c := make(chan os.Signal, 1)
+	// Accept SIGINT (Ctrl+C) and SIGTERM (`docker stop`)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	// Restore the default behavior when returning, so that signals still end the program when Run() returns after Stop()
+	defer signal.Stop(c)
+	select {
+	case sig := <-c:
+		logger.Info("Received signal, shutting down server...", zap.Stringer("signal", sig))
+	case <-a.stopChan:
+		logger.Info("Addon was stopped, shutting down server...")
+	}
+	cancelStart()
+	*stoppingPtr = true
+	if stoppingChan != nil {
+		stoppingChan <- true
+	}
+	// Both the server shutdown and the metrics flush must finish within the grace period.
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownGracePeriod)
+	defer cancelShutdown()
+	// Graceful shutdown, waiting for all current requests to finish without accepting new ones.
+	if err := app.ShutdownWithContext(shutdownCtx); err != nil {
+		logger.Error("Error shutting down server", zap.Error(err))
+	}
+	logger.Info("Finished shutting down server")
+	// Flush metrics after the server shutdown, so that the final counts include the last requests.
+	if a.opts.MetricsFlush != nil {
+		logger.Info("Flushing metrics...")
+		if err := a.opts.MetricsFlush(shutdownCtx); err != nil {
+			logger.Error("Couldn't flush metrics", zap.Error(err))
+		} else {
+			logger.Info("Finished flushing metrics")
+		}
+	}
+}
+
+// Stop shuts down an addon that was started with Run(), the same way as when receiving a shutdown signal.
+// It doesn't block, but Run() returns once the shutdown is finished.
+func (a *Addon) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.stopChan)
+	})
+}
+
+// createApp creates the Fiber app with all middlewares and endpoints of the addon, without starting it.
+func (a *Addon) createApp() *fiber.App {
+	logger := a.logger
+
 	app := fiber.New(fiber.Config{
 		DisableStartupMessage: true,
 		BodyLimit:             0,
 		ReadTimeout:           5 * time.Second,
-		// Docker stop only gives us 10s. We want to close all connections before that.
-		WriteTimeout: 9 * time.Second,
-		IdleTimeout:  9 * time.Second,
+		WriteTimeout:          shutdownGracePeriod,
+		IdleTimeout:           shutdownGracePeriod,
 	})
 
 	// Middlewares
 
 	app.Use(recover.New())
 	if !a.opts.DisableRequestLogging {
-		app.Use(createLoggingMiddleware(logger, a.opts.LogIPs, a.opts.LogUserAgent, a.opts.LogMediaName, a.manifest.BehaviorHints.ConfigurationRequired))
+		app.Use(createLoggingMiddleware(logger, a.clientIP, a.opts.LogIPs, a.opts.LogUserAgent, a.opts.LogMediaName, a.manifest.BehaviorHints.ConfigurationRequired))
 	}
 	if a.opts.Metrics {
 		app.Use(createMetricsMiddleware())
 	}
+	if a.opts.Compression {
+		app.Use(compress.New(compress.Config{
+			Level: a.opts.CompressLevel.fiberLevel(),
+		}))
+	}
 	app.Use(corsMiddleware()) // Stremio doesn't show stream responses when no CORS middleware is used!
+	// Reject resource requests while the start callback is still running. The manifest is still served, so that addon installations succeed during a slow startup.
+	readinessMw := createReadinessMiddleware(a.isReady, logger)
+	for _, path := range append([]string{"/stream/:type/:id.json", "/meta/:type/:id.json"}, catalogPaths...) {
+		app.Use(path, readinessMw)
+		app.Use("/:userData"+path, readinessMw)
+	}
 	// Filter some requests (like for requests without user data when the addon requires configuration, or for missing type or id URL parameters) and put some request info in the context
 	addRouteMatcherMiddleware(app, a.manifest.BehaviorHints.ConfigurationRequired, a.opts.StreamIDregex, logger)
+	// Limit concurrent stream requests before looking up any meta
+	if a.opts.MaxConcurrentStreams != 0 || a.opts.MaxConcurrentStreamsPerIP != 0 {
+		streamLimitMw := createStreamLimitMiddleware(a.opts.MaxConcurrentStreams, a.opts.MaxConcurrentStreamsPerIP, a.clientIP, logger)
+		if !a.manifest.BehaviorHints.ConfigurationRequired {
+			app.Use("/stream/:type/:id.json", streamLimitMw)
+		}
+		app.Use("/:userData/stream/:type/:id.json", streamLimitMw)
+	}
 	metaMw := createMetaMiddleware(a.metaClient, a.opts.PutMetaInContext, a.opts.LogMediaName, logger)
 	// Meta middleware only works for stream requests.
 	if !a.manifest.BehaviorHints.ConfigurationRequired {
@@ -280,20 +541,28 @@ func (a *Addon) Run(stoppingChan chan bool) {
 	// Stremio endpoints
 
 	// In Fiber optional parameters don't work at the beginning of the URL, so we have to register two routes each
-	manifestHandler := createManifestHandler(a.manifest, logger, a.manifestCallback, a.userDataType, a.opts.UserDataIsBase64)
+	manifestHandler := createManifestHandler(a.manifest, a.opts.JSONContentType, logger, a.manifestCallback, a.userDataType, a.opts.UserDataIsBase64)
 	// We always register this route, because even if BehaviorHints.ConfigurationRequired is true, this endpoint is required for the addon to be listed in Stremio's community addons.
 	app.Get("/manifest.json", manifestHandler)
 	app.Get("/:userData/manifest.json", manifestHandler)
 	if a.catalogHandlers != nil {
-		catalogHandler := createCatalogHandler(a.catalogHandlers, a.opts.CacheAgeCatalogs, a.opts.CachePublicCatalogs, a.opts.HandleEtagCatalogs, logger, a.userDataType, a.opts.UserDataIsBase64)
-		if !a.manifest.BehaviorHints.ConfigurationRequired {
-			app.Get("/catalog/:type/:id.json", catalogHandler)
+		cursors := newCursorStore(a.opts.CatalogCursorTTL)
+		catalogExtraMw := createCatalogExtraMiddleware(cursors, logger)
+		var previews *previewEnricher
+		if a.opts.PreviewResolver != nil {
+			previews = newPreviewEnricher(a.opts.PreviewResolver, a.opts.PreviewCacheTTL, logger)
+		}
+		catalogHandler := createCatalogHandler(a.catalogHandlers, cursors, previews, a.opts.JSONContentType, a.opts.CacheAgeCatalogs, a.opts.CachePublicCatalogs, a.opts.HandleEtagCatalogs, a.opts.Metrics, logger, a.userDataType, a.opts.UserDataIsBase64)
+		for _, path := range catalogPaths {
+			if !a.manifest.BehaviorHints.ConfigurationRequired {
+				app.Get(path, catalogExtraMw, catalogHandler)
+			}
+			// We always register this route, because we don't know if the addon developer wants to use user data or not, as BehaviorHints.Configurable only indicates the configurability *via Stremio*
+			app.Get("/:userData"+path, catalogExtraMw, catalogHandler)
 		}
-		// We always register this route, because we don't know if the addon developer wants to use user data or not, as BehaviorHints.Configurable only indicates the configurability *via Stremio*
-		app.Get("/:userData/catalog/:type/:id.json", catalogHandler)
 	}
 	if a.streamHandlers != nil {
-		streamHandler := createStreamHandler(a.streamHandlers, a.opts.CacheAgeStreams, a.opts.CachePublicStreams, a.opts.HandleEtagStreams, logger, a.userDataType, a.opts.UserDataIsBase64)
+		streamHandler := createStreamHandler(a.streamHandlers, a.opts.JSONContentType, a.opts.CacheAgeStreams, a.opts.CacheAgeEmptyStreams, a.opts.CachePublicStreams, a.opts.HandleEtagStreams, a.opts.Metrics, logger, a.userDataType, a.opts.UserDataIsBase64)
 		if !a.manifest.BehaviorHints.ConfigurationRequired {
 			app.Get("/stream/:type/:id.json", streamHandler)
 		}
@@ -301,7 +570,7 @@ func (a *Addon) Run(stoppingChan chan bool) {
 		app.Get("/:userData/stream/:type/:id.json", streamHandler)
 	}
 	if a.metaHandlers != nil {
-		metaHandler := createMetaHandler(a.metaHandlers, a.opts.CacheAgeMeta, a.opts.CachePublicMeta, a.opts.HandleEtagMeta, logger, a.userDataType, a.opts.UserDataIsBase64)
+		metaHandler := createMetaHandler(a.metaHandlers, a.opts.JSONContentType, a.opts.CacheAgeMeta, a.opts.CachePublicMeta, a.opts.HandleEtagMeta, a.opts.Metrics, logger, a.userDataType, a.opts.UserDataIsBase64)
 		if !a.manifest.BehaviorHints.ConfigurationRequired {
 			app.Get("/meta/:type/:id.json", metaHandler)
 		}
@@ -337,37 +606,5 @@ func (a *Addon) Run(stoppingChan chan bool) {
 		app.Add(customEndpoint.method, customEndpoint.path, customEndpoint.handler)
 	}
 
-	logger.Info("Finished setting up server")
-
-	stopping := false
-	stoppingPtr := &stopping
-
-	addr := a.opts.BindAddr + ":" + strconv.Itoa(a.opts.Port)
-	logger.Info("Starting server", zap.String("address", addr))
-	go func() {
-		if err := app.Listen(addr); err != nil {
-			if !*stoppingPtr {
-				logger.Fatal("Couldn't start server", zap.Error(err))
-			} else {
-				logger.Fatal("Error in srv.ListenAndServe() during server shutdown (probably context deadline expired before the server could shutdown cleanly)", zap.Error(err))
-			}
-		}
-	}()
-
-	// Graceful shutdown
-
-	c := make(chan os.Signal, 1)
-	// Accept SIGINT (Ctrl+C) and SIGTERM (`docker stop`)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	sig := <-c
-	logger.Info("Received signal, shutting down server...", zap.Stringer("signal", sig))
-	*stoppingPtr = true
-	if stoppingChan != nil {
-		stoppingChan <- true
-	}
-	// Graceful shutdown, waiting for all current requests to finish without accepting new ones.
-	if err := app.Shutdown(); err != nil {
-		logger.Fatal("Error shutting down server", zap.Error(err))
-	}
-	logger.Info("Finished shutting down server")
+	return app
 }
@@ -1,12 +1,47 @@
 package stremio
 
 import (
+	"context"
 	"net/http"
 	"time"
 
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
 	"go.uber.org/zap"
 )
 
+// CompressLevel is the trade-off between CPU usage and response size when compressing responses.
+type CompressLevel int
+
+const (
+	// CompressLevelDefault balances CPU usage and response size.
+	CompressLevelDefault CompressLevel = iota
+	// CompressLevelBestSpeed uses the least CPU, for example for large catalogs on a constrained CPU.
+	CompressLevelBestSpeed
+	// CompressLevelBestCompression leads to the smallest responses, for example when bandwidth is constrained.
+	CompressLevelBestCompression
+)
+
+func (l CompressLevel) fiberLevel() compress.Level {
+	switch l {
+	case CompressLevelBestSpeed:
+		return compress.LevelBestSpeed
+	case CompressLevelBestCompression:
+		return compress.LevelBestCompression
+	}
+	return compress.LevelDefault
+}
+
+func (l CompressLevel) String() string {
+	switch l {
+	case CompressLevelBestSpeed:
+		return "best-speed"
+	case CompressLevelBestCompression:
+		return "best-compression"
+	}
+	return "default"
+}
+
 // Options are the options that can be used to configure the addon.
 type Options struct {
 	// The interface to bind to.
@@ -54,8 +89,20 @@ type Options struct {
 	// The URL is the standard one: "/metrics".
 	// There's no credentials required for accessing it. If you expose deflix-stremio to the public,
 	// you might want to protect the metrics route in your reverse proxy.
+	// Besides request counts it contains the HTTP cache decisions of the catalog, stream and meta handlers:
+	// "http_cache_requests_total" with the labels "resource" (like "stream") and "result", and the histogram "http_cache_saved_bytes" with the "resource" label.
+	// The SDK doesn't cache handler results on the server side, so the decisions are about the ETag revalidation (see HandleEtagCatalogs etc.).
+	// A "hit" is a request whose "If-None-Match" header matches, so the response body isn't sent. "http_cache_saved_bytes" is the size of those bodies.
+	// A "miss" is a request with a non-matching "If-None-Match" header, and a "bypass" one without the header or without ETag handling being enabled.
+	// There's no "stale-served" result and no histogram of saved handler time, because the handler is called for every request and nothing stale is ever served.
 	// Default false.
 	Metrics bool
+	// Function for flushing metrics when the addon shuts down, for example for pushing the final counts to a Prometheus Pushgateway or StatsD.
+	// It's called after the server finished handling the last requests, with a context that's cancelled when the shutdown grace period is over.
+	// Not required for Prometheus scraping the "/metrics" endpoint.
+	// Only relevant when Metrics is true.
+	// Default nil.
+	MetricsFlush func(ctx context.Context) error
 	// Duration of client/proxy-side cache for responses from the catalog endpoint.
 	// Helps reducing number of requsts and transferred data volume to/from the server.
 	// The result is not cached by the SDK on the server side, so if two *separate* users make a reqeust,
@@ -64,6 +111,14 @@ type Options struct {
 	CacheAgeCatalogs time.Duration
 	// Same as CacheAgeCatalogs, but for streams.
 	CacheAgeStreams time.Duration
+	// Cache age for stream responses without any streams, which overrides CacheAgeStreams for them.
+	// For live or just released content, streams might not exist yet, but will soon.
+	// A long cache age would then prevent users from seeing the streams once they exist,
+	// so a short one like 5 minutes lets Stremio and proxies retry soon ("empty-but-coming").
+	// Your StreamHandler just returns an empty slice (not the NotFound error, which leads to a "404 Not Found" response without caching).
+	// Can also be set without CacheAgeStreams to only let empty results be cached.
+	// Default 0 (meaning CacheAgeStreams is used for empty results as well).
+	CacheAgeEmptyStreams time.Duration
 	// Same as CacheAgeCatalogs, but for meta.
 	CacheAgeMeta time.Duration
 	// Flag for indicating to proxies whether they are allowed to cache responses from the catalog endpoint.
@@ -94,6 +149,7 @@ type Options struct {
 	PutMetaInContext bool
 	// Flag for indicating whether to include the movie / TV show name (and year) in the request log.
 	// Only works for stream requests.
+	// The MetaFetcher is asked for the name in the language of the request's "Accept-Language" header, falling back to English.
 	// Default false.
 	LogMediaName bool
 	// Meta client for fetching movie and TV show info.
@@ -107,6 +163,14 @@ type Options struct {
 	// Note that each response is cached for 30 days, so waiting a bit once per movie / TV show per 30 days is acceptable.
 	// Default 2 seconds.
 	CinemetaTimeout time.Duration
+	// Resolver for enriching bare meta preview items (with only the ID set) that a CatalogHandler returns.
+	// The results are cached in memory, see PreviewCacheTTL. The cache is limited to 100,000 items, and expired items are removed when it's full.
+	// Default nil.
+	PreviewResolver PreviewResolver
+	// Max age of meta preview items from the PreviewResolver in the in-memory cache.
+	// Only relevant when setting a PreviewResolver.
+	// Default 24 hours.
+	PreviewCacheTTL time.Duration
 	// "File system" with HTML files that will be served for the "/configure" endpoint.
 	// Typically an `http.Dir`, which you can simply create with `http.Dir("/path/to/html/files")`.
 	// For using it with Go's embedding feature, you can either use `http.FS(embedFS)` directly,
@@ -122,14 +186,59 @@ type Options struct {
 	// IMDb example: "^tt\\d{7,8}$" or `^tt\d{7,8}$`
 	// Default "".
 	StreamIDregex string
+	// Maximum number of stream requests that are handled concurrently, across all clients.
+	// Resolving streams (for example via torrent backends) can be expensive, so this protects your backends from being overloaded.
+	// Excess requests are rejected with "503 Service Unavailable" and a short "Retry-After".
+	// This is independent of any other rate limiting.
+	// 0 means no limit.
+	// Default 0.
+	MaxConcurrentStreams int
+	// Same as MaxConcurrentStreams, but per client IP address.
+	// Excess requests are rejected with "429 Too Many Requests" and a short "Retry-After".
+	// The client IP is the trusted client IP (see ProxyHeader and TrustedProxies).
+	// When running behind a reverse proxy without setting ProxyHeader, all clients share the proxy's IP and this limit effectively becomes a global one.
+	// 0 means no limit.
+	// Default 0.
+	MaxConcurrentStreamsPerIP int
+	// Name of the header that contains the client IP when running behind a reverse proxy, like "X-Forwarded-For" or "X-Real-IP".
+	// The rightmost IP in the header that's not one of the TrustedProxies is used as client IP, for example for IP logging and MaxConcurrentStreamsPerIP.
+	// Entries further to the left are ignored, because clients can set them to arbitrary values, and proxies append to the header instead of replacing it.
+	// When empty, the remote address of the connection is used.
+	// Default "".
+	ProxyHeader string
+	// IP addresses or CIDR ranges of reverse proxies whose ProxyHeader is trusted, like "10.0.0.0/8".
+	// For requests from other addresses the header is ignored and the remote address of the connection is used.
+	// When there are multiple proxies in a chain, all of them must be listed, so that their entries in the header are skipped.
+	// Only relevant when setting ProxyHeader. When empty, the header of all requests is trusted and its rightmost IP is used.
+	// Default nil.
+	TrustedProxies []string
+	// Exact value of the "Content-Type" header for JSON responses, which are the responses of the manifest, catalog, stream and meta endpoints.
+	// Can be useful as workaround for proxies or clients that behave differently depending on the exact value, like "application/json".
+	// Default "application/json; charset=utf-8".
+	JSONContentType string
+	// Flag for indicating whether responses should be compressed (gzip, deflate or brotli, depending on the request's "Accept-Encoding" header).
+	// You usually don't need this when a reverse proxy in front of the addon already compresses responses.
+	// Default false.
+	Compression bool
+	// Compression level. Only relevant when Compression is true.
+	// Default CompressLevelDefault.
+	CompressLevel CompressLevel
+	// Max age of catalog cursors that a CatalogHandler set via SetNextCatalogCursor().
+	// The cursors are stored in memory and mapped to the skip value of the next page, because Stremio only sends numeric skip values.
+	// When a cursor is expired, the CatalogHandler gets an empty cursor and has to fall back to the skip value.
+	// Default 1 hour.
+	CatalogCursorTTL time.Duration
 }
 
 // DefaultOptions is an Options object with default values.
 // For fields that aren't set here the zero value is the default value.
 var DefaultOptions = Options{
-	BindAddr:        "localhost",
-	Port:            8080,
-	LoggingLevel:    "info",
-	LogEncoding:     "console",
-	CinemetaTimeout: 2 * time.Second,
+	BindAddr:         "localhost",
+	Port:             8080,
+	LoggingLevel:     "info",
+	LogEncoding:      "console",
+	CinemetaTimeout:  2 * time.Second,
+	CatalogCursorTTL: time.Hour,
+	JSONContentType:  fiber.MIMEApplicationJSONCharsetUTF8,
+	PreviewCacheTTL:  24 * time.Hour,
 }
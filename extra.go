@@ -0,0 +1,179 @@
+package stremio
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CatalogExtra contains the extra parameters of a catalog request.
+// Stremio only sends them when you declare them in the CatalogItem's Extra field in the manifest.
+// See https://github.com/Stremio/stremio-addon-sdk/blob/f6f1f2a8b627b9d4f2c62b003b251d98adadbebe/docs/api/requests/defineCatalogHandler.md#extra-parameters
+type CatalogExtra struct {
+	// Search query, for catalogs with the "search" extra.
+	Search string
+	// Genre to filter by, for catalogs with the "genre" extra.
+	Genre string
+	// Number of items to skip, for catalogs with the "skip" extra.
+	// Stremio sends it when the user scrolls to the end of the catalog, with the number of items it received so far.
+	Skip int
+	// Opaque cursor that the catalog handler set via SetNextCatalogCursor() for the previous page.
+	// It's empty for the first page, and also when the SDK doesn't know the cursor anymore,
+	// for example because the addon was restarted or the cursor expired (see Options.CatalogCursorTTL).
+	// In that case the handler must fall back to using Skip.
+	Cursor string
+}
+
+// GetCatalogExtraFromContext returns the extra parameters of the catalog request.
+// Use it in your CatalogHandler with the context that's passed to it. If the request didn't contain any extra parameters, the zero value is returned.
+func GetCatalogExtraFromContext(ctx context.Context) CatalogExtra {
+	extra, _ := ctx.Value("catalogExtra").(CatalogExtra)
+	return extra
+}
+
+// SetNextCatalogCursor lets your CatalogHandler return an opaque cursor for the next page, for backends that paginate by cursor instead of offset.
+// Stremio only knows numeric skip values, so the SDK stores the cursor on the server side, mapped to the skip value Stremio will send for the next page
+// (the current skip value plus the number of returned items). When that request comes in, the cursor is available in CatalogExtra.Cursor.
+// Use it with the context that's passed to your CatalogHandler. Calls with other contexts are ignored.
+func SetNextCatalogCursor(ctx context.Context, cursor string) {
+	if c, ok := ctx.Value("catalogCursor").(*catalogCursor); ok {
+		c.next = cursor
+	}
+}
+
+// catalogCursor is put into the context of catalog requests so that the handler can set the next cursor.
+type catalogCursor struct {
+	// Key for the cursor store, without the skip value
+	key  string
+	skip int
+	// Set by the handler
+	next string
+}
+
+// maxExtraLength limits the length of the extra URL segment. Stremio's search queries are the longest legitimate values.
+const maxExtraLength = 2048
+
+// parseCatalogExtra parses the extra URL segment of a catalog request, like "genre=Action&skip=100".
+// Keys and values are percent-encoded. Unknown keys are ignored, but malformed pairs, duplicate known keys and invalid skip values lead to an error,
+// because a partially parsed extra could silently lead to a wrong catalog page.
+func parseCatalogExtra(extra string) (CatalogExtra, error) {
+	var result CatalogExtra
+	if extra == "" {
+		return result, nil
+	}
+	if len(extra) > maxExtraLength {
+		return result, fmt.Errorf("Extra is too long: %v bytes (max %v)", len(extra), maxExtraLength)
+	}
+	seen := map[string]bool{}
+	for _, pair := range strings.Split(extra, "&") {
+		// Allow empty pairs like in "genre=Action&&skip=100"
+		if pair == "" {
+			continue
+		}
+		eqIndex := strings.Index(pair, "=")
+		if eqIndex < 0 {
+			return result, fmt.Errorf("Malformed extra: pair %q has no \"=\"", pair)
+		}
+		key, err := url.QueryUnescape(pair[:eqIndex])
+		if err != nil {
+			return result, fmt.Errorf("Malformed extra: couldn't decode key %q: %w", pair[:eqIndex], err)
+		}
+		if key == "" {
+			return result, fmt.Errorf("Malformed extra: pair %q has an empty key", pair)
+		}
+		value, err := url.QueryUnescape(pair[eqIndex+1:])
+		if err != nil {
+			return result, fmt.Errorf("Malformed extra: couldn't decode value of %q: %w", key, err)
+		}
+
+		switch key {
+		case "search", "genre", "skip":
+			if seen[key] {
+				return result, fmt.Errorf("Malformed extra: duplicate key %q", key)
+			}
+			seen[key] = true
+		default:
+			// Unknown keys are ignored, for example for extras that Stremio adds in the future
+			continue
+		}
+
+		switch key {
+		case "search":
+			result.Search = value
+		case "genre":
+			result.Genre = value
+		case "skip":
+			skip, err := strconv.Atoi(value)
+			if err != nil {
+				return result, fmt.Errorf("Malformed extra: skip value %q isn't an integer", value)
+			}
+			if skip < 0 {
+				return result, fmt.Errorf("Malformed extra: skip value %v is negative", skip)
+			}
+			result.Skip = skip
+		}
+	}
+	return result, nil
+}
+
+// cursorKey returns the key for the cursor store, so that cursors of different users, catalogs and filters don't get mixed up.
+func cursorKey(userData, t, id string, extra CatalogExtra) string {
+	return strings.Join([]string{userData, t, id, extra.Search, extra.Genre}, "\x00")
+}
+
+// catalogCursorMaxEntries limits the memory usage of the cursor store.
+const catalogCursorMaxEntries = 100000
+
+type cursorItem struct {
+	cursor  string
+	created time.Time
+}
+
+// cursorStore maps catalog pages (identified by a key and skip value) to the cursors that the catalog handler returned for them.
+type cursorStore struct {
+	items map[string]cursorItem
+	lock  *sync.RWMutex
+	ttl   time.Duration
+}
+
+func newCursorStore(ttl time.Duration) *cursorStore {
+	return &cursorStore{
+		items: map[string]cursorItem{},
+		lock:  &sync.RWMutex{},
+		ttl:   ttl,
+	}
+}
+
+func (s *cursorStore) set(key string, skip int, cursor string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.items) >= catalogCursorMaxEntries {
+		for k, item := range s.items {
+			if time.Since(item.created) > s.ttl {
+				delete(s.items, k)
+			}
+		}
+		// Still full, so the handler has to fall back to using the skip value
+		if len(s.items) >= catalogCursorMaxEntries {
+			return
+		}
+	}
+	s.items[key+"\x00"+strconv.Itoa(skip)] = cursorItem{
+		cursor:  cursor,
+		created: time.Now(),
+	}
+}
+
+func (s *cursorStore) get(key string, skip int) string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	item, found := s.items[key+"\x00"+strconv.Itoa(skip)]
+	if !found || time.Since(item.created) > s.ttl {
+		return ""
+	}
+	return item.cursor
+}
@@ -0,0 +1,111 @@
+package stremio
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseCatalogExtra(t *testing.T) {
+	tests := []struct {
+		name     string
+		extra    string
+		expected CatalogExtra
+		err      bool
+	}{
+		{name: "empty", extra: ""},
+		{name: "skip", extra: "skip=100", expected: CatalogExtra{Skip: 100}},
+		{name: "all", extra: "search=big%20buck&genre=Sci-Fi&skip=20", expected: CatalogExtra{Search: "big buck", Genre: "Sci-Fi", Skip: 20}},
+		{name: "plus as space", extra: "search=big+buck", expected: CatalogExtra{Search: "big buck"}},
+		{name: "encoded ampersand", extra: "genre=Action%26Adventure", expected: CatalogExtra{Genre: "Action&Adventure"}},
+		{name: "encoded equals sign in value", extra: "search=a%3Db", expected: CatalogExtra{Search: "a=b"}},
+		{name: "raw equals sign in value", extra: "search=a=b", expected: CatalogExtra{Search: "a=b"}},
+		{name: "empty value", extra: "genre=", expected: CatalogExtra{}},
+		{name: "empty pairs", extra: "&genre=Action&&skip=1&", expected: CatalogExtra{Genre: "Action", Skip: 1}},
+		{name: "unknown key", extra: "foo=bar&skip=1", expected: CatalogExtra{Skip: 1}},
+		{name: "duplicate unknown key", extra: "foo=bar&foo=baz", expected: CatalogExtra{}},
+		{name: "unicode", extra: "search=%E6%97%A5%E6%9C%AC", expected: CatalogExtra{Search: "日本"}},
+		{name: "no equals sign", extra: "skip", err: true},
+		{name: "unbalanced pair", extra: "genre=Action&skip", err: true},
+		{name: "empty key", extra: "=100", err: true},
+		{name: "bad percent-encoding in value", extra: "search=100%", err: true},
+		{name: "bad percent-encoding in key", extra: "se%zzarch=a", err: true},
+		{name: "invalid hex in percent-encoding", extra: "search=%G1", err: true},
+		{name: "skip not an integer", extra: "skip=abc", err: true},
+		{name: "skip float", extra: "skip=1.5", err: true},
+		{name: "skip negative", extra: "skip=-1", err: true},
+		{name: "skip overflow", extra: "skip=99999999999999999999999", err: true},
+		{name: "empty skip", extra: "skip=", err: true},
+		{name: "duplicate skip", extra: "skip=1&skip=2", err: true},
+		{name: "duplicate genre", extra: "genre=a&genre=b", err: true},
+		{name: "too long", extra: "search=" + strings.Repeat("a", maxExtraLength), err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			extra, err := parseCatalogExtra(test.extra)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, extra)
+		})
+	}
+}
+
+// TestParseCatalogExtraRandom makes sure that arbitrary input never leads to a panic,
+// and that properly encoded values are always parsed correctly.
+func TestParseCatalogExtraRandom(t *testing.T) {
+	noPanic := func(extra string) bool {
+		_, _ = parseCatalogExtra(extra)
+		return true
+	}
+	require.NoError(t, quick.Check(noPanic, nil))
+
+	roundTrip := func(search, genre string, skip uint16) bool {
+		values := url.Values{}
+		values.Set("search", search)
+		values.Set("genre", genre)
+		values.Set("skip", strconv.Itoa(int(skip)))
+		extra, err := parseCatalogExtra(values.Encode())
+		if len(values.Encode()) > maxExtraLength {
+			return err != nil
+		}
+		return err == nil && extra == CatalogExtra{Search: search, Genre: genre, Skip: int(skip)}
+	}
+	require.NoError(t, quick.Check(roundTrip, nil))
+}
+
+func TestMalformedCatalogExtraRequest(t *testing.T) {
+	called := false
+	catalogHandlers := map[string]CatalogHandler{
+		"movie": func(ctx context.Context, id string, userData interface{}) ([]MetaPreviewItem, error) {
+			called = true
+			return []MetaPreviewItem{}, nil
+		},
+	}
+	addon, err := NewAddon(testManifest, catalogHandlers, nil, nil, Options{Logger: zap.NewNop()})
+	require.NoError(t, err)
+	app := addon.createApp()
+
+	for _, extra := range []string{"genre=Action&skip", "skip=-1", "=1", "skip=1&skip=2"} {
+		t.Run(extra, func(t *testing.T) {
+			res, err := app.Test(httptest.NewRequest("GET", "/catalog/movie/test-catalog/"+extra+".json", nil))
+			require.NoError(t, err)
+			require.Equal(t, fiber.StatusBadRequest, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			require.Contains(t, string(body), "Malformed extra")
+		})
+	}
+	require.False(t, called, "handler was called for a malformed extra")
+}
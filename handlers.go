@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/VictoriaMetrics/metrics"
 	"github.com/cespare/xxhash/v2"
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
@@ -30,7 +31,7 @@ func createHealthHandler(logger *zap.Logger) fiber.Handler {
 	}
 }
 
-func createManifestHandler(manifest Manifest, logger *zap.Logger, manifestCallback ManifestCallback, userDataType reflect.Type, userDataIsBase64 bool) fiber.Handler {
+func createManifestHandler(manifest Manifest, contentType string, logger *zap.Logger, manifestCallback ManifestCallback, userDataType reflect.Type, userDataIsBase64 bool) fiber.Handler {
 	// When there's user data we want Stremio to show the "Install" button, which it only does when "configurationRequired" is false.
 	// To not change the boolean value of the manifest object on the fly and thus mess with a single object across concurrent goroutines, we copy it and return two different objects.
 	// Note that this manifest copy has some values shallowly copied, but `BehaviorHints.ConfigurationRequired` is a simple type and thus a real copy.
@@ -85,49 +86,57 @@ func createManifestHandler(manifest Manifest, logger *zap.Logger, manifestCallba
 				logger.Fatal("Couldn't marshal cloned manifest", zap.Error(err))
 			}
 			logger.Debug("Responding", zap.ByteString("body", clonedManifestBody))
-			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			c.Set(fiber.HeaderContentType, contentType)
 			return c.Send(clonedManifestBody)
 		}
 
 		if configured {
 			logger.Debug("Responding", zap.ByteString("body", configuredManifestBody))
-			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			c.Set(fiber.HeaderContentType, contentType)
 			return c.Send(configuredManifestBody)
 		} else {
 			logger.Debug("Responding", zap.ByteString("body", manifestBody))
-			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			c.Set(fiber.HeaderContentType, contentType)
 			return c.Send(manifestBody)
 		}
 	}
 }
 
-func createCatalogHandler(catalogHandlers map[string]CatalogHandler, cacheAge time.Duration, cachePublic, handleEtag bool, logger *zap.Logger, userDataType reflect.Type, userDataIsBase64 bool) fiber.Handler {
+func createCatalogHandler(catalogHandlers map[string]CatalogHandler, cursors *cursorStore, previews *previewEnricher, contentType string, cacheAge time.Duration, cachePublic, handleEtag bool, collectMetrics bool, logger *zap.Logger, userDataType reflect.Type, userDataIsBase64 bool) fiber.Handler {
 	handlers := make(map[string]handler, len(catalogHandlers))
 	for k, v := range catalogHandlers {
-		handlers[k] = convertCatalogHandler(v)
+		handlers[k] = convertCatalogHandler(k, v, cursors, previews)
 	}
-	return createHandler("catalog", handlers, []byte("metas"), cacheAge, cachePublic, handleEtag, logger, userDataType, userDataIsBase64)
+	return createHandler("catalog", handlers, []byte("metas"), contentType, cacheAge, 0, cachePublic, handleEtag, collectMetrics, logger, userDataType, userDataIsBase64)
 }
 
-func createStreamHandler(streamHandlers map[string]StreamHandler, cacheAge time.Duration, cachePublic, handleEtag bool, logger *zap.Logger, userDataType reflect.Type, userDataIsBase64 bool) fiber.Handler {
+func createStreamHandler(streamHandlers map[string]StreamHandler, contentType string, cacheAge, emptyCacheAge time.Duration, cachePublic, handleEtag bool, collectMetrics bool, logger *zap.Logger, userDataType reflect.Type, userDataIsBase64 bool) fiber.Handler {
 	handlers := make(map[string]handler, len(streamHandlers))
 	for k, v := range streamHandlers {
 		handlers[k] = convertStreamHandler(v)
 	}
-	return createHandler("stream", handlers, []byte("streams"), cacheAge, cachePublic, handleEtag, logger, userDataType, userDataIsBase64)
+	return createHandler("stream", handlers, []byte("streams"), contentType, cacheAge, emptyCacheAge, cachePublic, handleEtag, collectMetrics, logger, userDataType, userDataIsBase64)
 }
 
-func createMetaHandler(metaHandlers map[string]MetaHandler, cacheAge time.Duration, cachePublic, handleEtag bool, logger *zap.Logger, userDataType reflect.Type, userDataIsBase64 bool) fiber.Handler {
+func createMetaHandler(metaHandlers map[string]MetaHandler, contentType string, cacheAge time.Duration, cachePublic, handleEtag bool, collectMetrics bool, logger *zap.Logger, userDataType reflect.Type, userDataIsBase64 bool) fiber.Handler {
 	handlers := make(map[string]handler, len(metaHandlers))
 	for k, v := range metaHandlers {
 		handlers[k] = convertMetaHandler(v)
 	}
-	return createHandler("meta", handlers, []byte("meta"), cacheAge, cachePublic, handleEtag, logger, userDataType, userDataIsBase64)
+	return createHandler("meta", handlers, []byte("meta"), contentType, cacheAge, 0, cachePublic, handleEtag, collectMetrics, logger, userDataType, userDataIsBase64)
 }
 
-func convertCatalogHandler(h CatalogHandler) handler {
+func convertCatalogHandler(t string, h CatalogHandler, cursors *cursorStore, previews *previewEnricher) handler {
 	return func(ctx context.Context, id string, userData interface{}) (interface{}, error) {
-		return h(ctx, id, userData)
+		items, err := h(ctx, id, userData)
+		if err == nil && previews != nil {
+			items, err = previews.enrich(ctx, t, items)
+		}
+		// Remember the cursor for the skip value of the next page
+		if cursor, ok := ctx.Value("catalogCursor").(*catalogCursor); ok && err == nil && cursor.next != "" && len(items) > 0 {
+			cursors.set(cursor.key, cursor.skip+len(items), cursor.next)
+		}
+		return items, err
 	}
 }
 
@@ -146,20 +155,16 @@ func convertMetaHandler(h MetaHandler) handler {
 // Common handler (same signature as both catalog, stream and meta handler)
 type handler func(ctx context.Context, id string, userData interface{}) (interface{}, error)
 
-func createHandler(handlerName string, handlers map[string]handler, jsonArrayKey []byte, cacheAge time.Duration, cachePublic, handleEtag bool, logger *zap.Logger, userDataType reflect.Type, userDataIsBase64 bool) fiber.Handler {
+func createHandler(handlerName string, handlers map[string]handler, jsonArrayKey []byte, contentType string, cacheAge, emptyCacheAge time.Duration, cachePublic, handleEtag bool, collectMetrics bool, logger *zap.Logger, userDataType reflect.Type, userDataIsBase64 bool) fiber.Handler {
+	var cacheMetrics *cacheMetrics
+	if collectMetrics {
+		cacheMetrics = newCacheMetrics(handlerName)
+	}
 	handlerName = handlerName + "Handler"
 	handlerLogMsg := handlerName + " called"
 
-	var cacheHeaderVal string
-	if cacheAge != 0 {
-		cacheAgeSeconds := strconv.FormatFloat(math.Round(cacheAge.Seconds()), 'f', 0, 64)
-		cacheHeaderVal = "max-age=" + cacheAgeSeconds
-		if cachePublic {
-			cacheHeaderVal += ", public"
-		} else {
-			cacheHeaderVal += ", private"
-		}
-	}
+	cacheHeaderVal := cacheControlValue(cacheAge, cachePublic)
+	emptyCacheHeaderVal := cacheControlValue(emptyCacheAge, cachePublic)
 
 	logger = logger.With(zap.String("handler", handlerName))
 
@@ -218,8 +223,18 @@ func createHandler(handlerName string, handlers map[string]handler, jsonArrayKey
 			return c.SendStatus(fiber.StatusInternalServerError)
 		}
 
+		// Empty results that are expected to fill in soon can have a shorter cache age
+		cacheHeader := cacheHeaderVal
+		if emptyCacheHeaderVal != "" && (string(resBody) == "[]" || string(resBody) == "null") {
+			logger.Debug("Empty result, using cache age for empty results", zapLogType, zapLogID)
+			cacheHeader = emptyCacheHeaderVal
+		}
+
 		// Handle ETag
 		var eTag string
+		if !handleEtag || c.Get("If-None-Match") == "" {
+			cacheMetrics.bypass()
+		}
 		if handleEtag {
 			hash := xxhash.Sum64(resBody)
 			eTag = strconv.FormatUint(hash, 16)
@@ -231,12 +246,16 @@ func createHandler(handlerName string, handlers map[string]handler, jsonArrayKey
 			} else if ifNoneMatch != eTag {
 				logger.Debug("If-None-Match != ETag", zapLogIfNoneMatch, zapLogETagServer, zapLogType, zapLogID)
 				modified = true
+				if ifNoneMatch != "" {
+					cacheMetrics.miss()
+				}
 			} else {
 				logger.Debug("ETag matches, responding with 304", zapLogIfNoneMatch, zapLogETagServer, zapLogType, zapLogID)
 			}
 			if !modified {
-				c.Set(fiber.HeaderCacheControl, cacheHeaderVal) // Required according to https://tools.ietf.org/html/rfc7232#section-4.1
-				c.Set(fiber.HeaderETag, eTag)                   // We set it to make sure a client doesn't overwrite its cached ETag with an empty string or so.
+				cacheMetrics.hit(len(resBody) + len(jsonArrayKey) + 5) // 5 for the JSON object around the array, see below
+				c.Set(fiber.HeaderCacheControl, cacheHeader)           // Required according to https://tools.ietf.org/html/rfc7232#section-4.1
+				c.Set(fiber.HeaderETag, eTag)                          // We set it to make sure a client doesn't overwrite its cached ETag with an empty string or so.
 				return c.SendStatus(fiber.StatusNotModified)
 			}
 		}
@@ -249,9 +268,9 @@ func createHandler(handlerName string, handlers map[string]handler, jsonArrayKey
 		}
 
 		logger.Debug("Responding", zap.ByteString("body", resBody), zapLogType, zapLogID)
-		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
-		if cacheHeaderVal != "" {
-			c.Set(fiber.HeaderCacheControl, cacheHeaderVal)
+		c.Set(fiber.HeaderContentType, contentType)
+		if cacheHeader != "" {
+			c.Set(fiber.HeaderCacheControl, cacheHeader)
 			if handleEtag {
 				c.Set(fiber.HeaderETag, eTag)
 			}
@@ -260,6 +279,61 @@ func createHandler(handlerName string, handlers map[string]handler, jsonArrayKey
 	}
 }
 
+// cacheControlValue returns the value for the "Cache-Control" header, or an empty string if the cache age is 0.
+func cacheControlValue(cacheAge time.Duration, cachePublic bool) string {
+	if cacheAge == 0 {
+		return ""
+	}
+	cacheAgeSeconds := strconv.FormatFloat(math.Round(cacheAge.Seconds()), 'f', 0, 64)
+	val := "max-age=" + cacheAgeSeconds
+	if cachePublic {
+		val += ", public"
+	} else {
+		val += ", private"
+	}
+	return val
+}
+
+// cacheMetrics counts the caching decisions of a resource handler.
+// The SDK doesn't cache handler results on the server side, so the decisions are about the HTTP cache revalidation via ETag:
+// A hit is a request with a matching "If-None-Match" header, a miss one with a non-matching header and a bypass one without the header or without ETag handling.
+// The handler is called in all cases, so instead of handler time the saved response bytes are measured.
+// All methods can be called on a nil *cacheMetrics, which doesn't collect anything.
+type cacheMetrics struct {
+	hits       *metrics.Counter
+	misses     *metrics.Counter
+	bypasses   *metrics.Counter
+	savedBytes *metrics.Histogram
+}
+
+func newCacheMetrics(resource string) *cacheMetrics {
+	return &cacheMetrics{
+		hits:       metrics.GetOrCreateCounter(`http_cache_requests_total{resource="` + resource + `", result="hit"}`),
+		misses:     metrics.GetOrCreateCounter(`http_cache_requests_total{resource="` + resource + `", result="miss"}`),
+		bypasses:   metrics.GetOrCreateCounter(`http_cache_requests_total{resource="` + resource + `", result="bypass"}`),
+		savedBytes: metrics.GetOrCreateHistogram(`http_cache_saved_bytes{resource="` + resource + `"}`),
+	}
+}
+
+func (m *cacheMetrics) hit(savedBytes int) {
+	if m != nil {
+		m.hits.Inc()
+		m.savedBytes.Update(float64(savedBytes))
+	}
+}
+
+func (m *cacheMetrics) miss() {
+	if m != nil {
+		m.misses.Inc()
+	}
+}
+
+func (m *cacheMetrics) bypass() {
+	if m != nil {
+		m.bypasses.Inc()
+	}
+}
+
 func createRootHandler(redirectURL string, logger *zap.Logger) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		logger.Debug("rootHandler called")
@@ -1,7 +1,9 @@
 package stremio
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/url"
 	"regexp"
 	"strconv"
@@ -16,12 +18,18 @@ import (
 	"go.uber.org/zap"
 )
 
+// defaultLanguage is the language that's passed to the MetaFetcher when a request doesn't contain a language hint.
+const defaultLanguage = "en"
+
+// catalogPaths are the paths of catalog requests without and with the extra URL segment (like "skip=100"), both without the user data prefix.
+var catalogPaths = []string{"/catalog/:type/:id.json", "/catalog/:type/:id/:extra.json"}
+
 type customMiddleware struct {
 	path string
 	mw   fiber.Handler
 }
 
-func createLoggingMiddleware(logger *zap.Logger, logIPs, logUserAgent, logMediaName bool, requiresUserData bool) fiber.Handler {
+func createLoggingMiddleware(logger *zap.Logger, clientIP func(*fiber.Ctx) string, logIPs, logUserAgent, logMediaName bool, requiresUserData bool) fiber.Handler {
 	// We always log status, duration, method, URL
 	zapFieldCount := 4
 	if logIPs {
@@ -72,7 +80,7 @@ func createLoggingMiddleware(logger *zap.Logger, logIPs, logUserAgent, logMediaN
 		zapFields[2] = zap.String("method", c.Method())
 		zapFields[3] = zap.String("url", c.OriginalURL())
 		if logIPs {
-			zapFields[4] = zap.String("ip", c.IP())
+			zapFields[4] = zap.String("ip", clientIP(c))
 			zapFields[5] = zap.Strings("forwardedFor", c.IPs())
 		}
 		if logUserAgent {
@@ -104,7 +112,7 @@ func createLoggingMiddleware(logger *zap.Logger, logIPs, logUserAgent, logMediaN
 
 func createMetricsMiddleware() fiber.Handler {
 	// Total number of errors from downstream handlers in the metrics middleware
-	errCounter := metrics.NewCounter("downstream_handlers_errors_total")
+	errCounter := metrics.GetOrCreateCounter("downstream_handlers_errors_total")
 
 	manifestRegex := regexp.MustCompile("^/.*/manifest.json$")
 	catalogRegex := regexp.MustCompile(`^/.*/catalog/.*/.*\.json`)
@@ -196,23 +204,36 @@ func corsMiddleware() fiber.Handler {
 	return cors.New(config)
 }
 
+func createReadinessMiddleware(isReady func() bool, logger *zap.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !isReady() {
+			logger.Debug("Rejecting request because the addon isn't ready yet")
+			c.Set(fiber.HeaderRetryAfter, "5")
+			return c.SendStatus(fiber.StatusServiceUnavailable)
+		}
+		return c.Next()
+	}
+}
+
 func addRouteMatcherMiddleware(app *fiber.App, requiresUserData bool, streamIDregexString string, logger *zap.Logger) {
 	streamIDregex := regexp.MustCompile(streamIDregexString)
 	if requiresUserData {
 		// Catalog
-		app.Use("/catalog/:type/:id.json", func(c *fiber.Ctx) error {
-			// If user data is required but not sent, let clients know they sent a bad request.
-			// That's better than responding with 404, leading to clients thinking it's a server-side error.
-			return c.SendStatus(fiber.StatusBadRequest)
-		})
-		app.Use("/:userData/catalog/:type/:id.json", func(c *fiber.Ctx) error {
-			if c.Params("type", "") == "" || c.Params("id", "") == "" {
-				logger.Debug("Rejecting bad request due to missing type or ID")
+		for _, path := range catalogPaths {
+			app.Use(path, func(c *fiber.Ctx) error {
+				// If user data is required but not sent, let clients know they sent a bad request.
+				// That's better than responding with 404, leading to clients thinking it's a server-side error.
 				return c.SendStatus(fiber.StatusBadRequest)
-			}
-			c.Locals("isConfigured", true)
-			return c.Next()
-		})
+			})
+			app.Use("/:userData"+path, func(c *fiber.Ctx) error {
+				if c.Params("type", "") == "" || c.Params("id", "") == "" {
+					logger.Debug("Rejecting bad request due to missing type or ID")
+					return c.SendStatus(fiber.StatusBadRequest)
+				}
+				c.Locals("isConfigured", true)
+				return c.Next()
+			})
+		}
 		// Stream
 		app.Use("/stream/:type/:id.json", func(c *fiber.Ctx) error {
 			return c.SendStatus(fiber.StatusBadRequest)
@@ -238,22 +259,24 @@ func addRouteMatcherMiddleware(app *fiber.App, requiresUserData bool, streamIDre
 		})
 	} else {
 		// Catalog
-		app.Use("/catalog/:type/:id.json", func(c *fiber.Ctx) error {
-			if c.Params("type", "") == "" || c.Params("id", "") == "" {
-				logger.Debug("Rejecting bad request due to missing type or ID")
-				return c.SendStatus(fiber.StatusBadRequest)
-			}
-			c.Locals("isConfigured", true)
-			return c.Next()
-		})
-		app.Use("/:userData/catalog/:type/:id.json", func(c *fiber.Ctx) error {
-			if c.Params("type", "") == "" || c.Params("id", "") == "" {
-				logger.Debug("Rejecting bad request due to missing type or ID")
-				return c.SendStatus(fiber.StatusBadRequest)
-			}
-			c.Locals("isConfigured", true)
-			return c.Next()
-		})
+		for _, path := range catalogPaths {
+			app.Use(path, func(c *fiber.Ctx) error {
+				if c.Params("type", "") == "" || c.Params("id", "") == "" {
+					logger.Debug("Rejecting bad request due to missing type or ID")
+					return c.SendStatus(fiber.StatusBadRequest)
+				}
+				c.Locals("isConfigured", true)
+				return c.Next()
+			})
+			app.Use("/:userData"+path, func(c *fiber.Ctx) error {
+				if c.Params("type", "") == "" || c.Params("id", "") == "" {
+					logger.Debug("Rejecting bad request due to missing type or ID")
+					return c.SendStatus(fiber.StatusBadRequest)
+				}
+				c.Locals("isConfigured", true)
+				return c.Next()
+			})
+		}
 		// Stream
 		app.Use("/stream/:type/:id.json", func(c *fiber.Ctx) error {
 			id := c.Params("id", "")
@@ -295,23 +318,106 @@ func addRouteMatcherMiddleware(app *fiber.App, requiresUserData bool, streamIDre
 	}
 }
 
+// createCatalogExtraMiddleware parses the extra URL segment of catalog requests and puts the result into the context.
+// It also looks up the cursor that the catalog handler returned for the previous page.
+func createCatalogExtraMiddleware(cursors *cursorStore, logger *zap.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		extra, err := parseCatalogExtra(c.Params("extra", ""))
+		if err != nil {
+			logger.Debug("Rejecting bad request due to malformed extra", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		cursor := &catalogCursor{
+			key:  cursorKey(c.Params("userData", ""), c.Params("type", ""), c.Params("id", ""), extra),
+			skip: extra.Skip,
+		}
+		if extra.Skip > 0 {
+			extra.Cursor = cursors.get(cursor.key, extra.Skip)
+		}
+		c.Locals("catalogExtra", extra)
+		c.Locals("catalogCursor", cursor)
+		return c.Next()
+	}
+}
+
+// createStreamLimitMiddleware limits the number of concurrently handled stream requests, globally and per client IP.
+// A limit of 0 means no limit.
+func createStreamLimitMiddleware(maxGlobal, maxPerIP int, clientIP func(*fiber.Ctx) string, logger *zap.Logger) fiber.Handler {
+	// A buffered channel acts as semaphore for the global limit
+	var globalSlots chan struct{}
+	if maxGlobal > 0 {
+		globalSlots = make(chan struct{}, maxGlobal)
+	}
+	perIP := map[string]int{}
+	lock := &sync.Mutex{}
+
+	return func(c *fiber.Ctx) error {
+		if maxPerIP > 0 {
+			ip := clientIP(c)
+			lock.Lock()
+			if perIP[ip] >= maxPerIP {
+				lock.Unlock()
+				logger.Debug("Rejecting stream request due to the per-IP concurrency limit", zap.String("ip", ip))
+				c.Set(fiber.HeaderRetryAfter, "1")
+				return c.SendStatus(fiber.StatusTooManyRequests)
+			}
+			perIP[ip]++
+			lock.Unlock()
+			defer func() {
+				lock.Lock()
+				if perIP[ip]--; perIP[ip] == 0 {
+					// Prevent the map from growing indefinitely
+					delete(perIP, ip)
+				}
+				lock.Unlock()
+			}()
+		}
+		if globalSlots != nil {
+			select {
+			case globalSlots <- struct{}{}:
+				defer func() { <-globalSlots }()
+			default:
+				logger.Debug("Rejecting stream request due to the global concurrency limit")
+				c.Set(fiber.HeaderRetryAfter, "1")
+				return c.SendStatus(fiber.StatusServiceUnavailable)
+			}
+		}
+		return c.Next()
+	}
+}
+
 func createMetaMiddleware(metaClient MetaFetcher, putMetaInHandlerContext, logMediaName bool, logger *zap.Logger) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		// type and id can never be empty, because that's been checked by a previous middleware
+		t := c.Params("type", "")
+		id := c.Params("id", "")
+		lang := requestLanguage(c)
+
 		// If we should put the meta in the context for *handlers* we get the meta synchronously.
 		// Otherwise we only need it for logging and can get the meta asynchronously.
 		if putMetaInHandlerContext {
-			putMetaInContext(c, metaClient, logger)
+			if meta, ok := getMeta(c.Context(), metaClient, t, id, lang, logger); ok {
+				c.Locals("meta", meta)
+			}
 			return c.Next()
 		} else if logMediaName {
+			// The goroutine must not access the Fiber context, because the handlers use it concurrently.
+			// That's also why it doesn't get the request context, which would read the Fiber context's values.
+			var meta cinemeta.Meta
+			var ok bool
 			var wg sync.WaitGroup
 			wg.Add(1)
 			go func() {
-				putMetaInContext(c, metaClient, logger)
+				meta, ok = getMeta(context.Background(), metaClient, t, id, lang, logger)
 				wg.Done()
 			}()
 			err := c.Next()
-			// Wait so that the meta is in the context when returning to the logging middleware
+			// Wait so that the meta is in the context when returning to the logging middleware.
+			// This makes the media name in the request log deterministic.
 			wg.Wait()
+			if ok {
+				c.Locals("meta", meta)
+			}
 			return err
 		} else {
 			return c.Next()
@@ -319,48 +425,130 @@ func createMetaMiddleware(metaClient MetaFetcher, putMetaInHandlerContext, logMe
 	}
 }
 
-func putMetaInContext(c *fiber.Ctx, metaClient MetaFetcher, logger *zap.Logger) {
+// getMeta fetches the meta for the given type and ID with the MetaFetcher.
+// The boolean return value signals whether the meta was found. Errors are logged.
+func getMeta(ctx context.Context, metaClient MetaFetcher, t, id, lang string, logger *zap.Logger) (cinemeta.Meta, bool) {
 	var meta cinemeta.Meta
 	var err error
-	// type and id can never be empty, because that's been checked by a previous middleware
-	t := c.Params("type", "")
-	id := c.Params("id", "")
 	id, err = url.PathUnescape(id)
 	if err != nil {
 		logger.Error("ID in URL parameters couldn't be unescaped", zap.String("id", id))
-		return
+		return meta, false
 	}
 
 	switch t {
 	case "movie":
-		meta, err = metaClient.GetMovie(c.Context(), id)
+		meta, err = metaClient.GetMovie(ctx, id, lang)
 		if err != nil {
 			logger.Error("Couldn't get movie info with MetaFetcher", zap.Error(err))
-			return
+			return meta, false
 		}
 	case "series":
 		splitID := strings.Split(id, ":")
 		if len(splitID) != 3 {
 			logger.Warn("No 3 elements after splitting TV show ID by \":\"", zap.String("id", id))
-			return
+			return meta, false
 		}
 		season, err := strconv.Atoi(splitID[1])
 		if err != nil {
 			logger.Warn("Can't parse season as int", zap.String("season", splitID[1]))
-			return
+			return meta, false
 		}
 		episode, err := strconv.Atoi(splitID[2])
 		if err != nil {
 			logger.Warn("Can't parse episode as int", zap.String("episode", splitID[2]))
-			return
+			return meta, false
 		}
-		meta, err = metaClient.GetTVShow(c.Context(), splitID[0], season, episode)
+		meta, err = metaClient.GetTVShow(ctx, splitID[0], season, episode, lang)
 		if err != nil {
 			logger.Error("Couldn't get TV show info with MetaFetcher", zap.Error(err))
-			return
+			return meta, false
 		}
+	default:
+		return meta, false
 	}
 
 	logger.Debug("Got meta from cinemata client", zap.String("meta", fmt.Sprintf("%+v", meta)))
-	c.Locals("meta", meta)
+	return meta, true
+}
+
+// requestLanguage returns the ISO 639-1 language code of the first language in the client's "Accept-Language" header.
+// Unlike catalog requests, stream requests don't have an extra URL segment that could carry a language hint, so the header is the only source.
+// Falls back to English if the header is missing or can't be parsed.
+func requestLanguage(c *fiber.Ctx) string {
+	acceptLanguage := c.Get(fiber.HeaderAcceptLanguage)
+	// For example "de-DE,de;q=0.9,en;q=0.8" or "*"
+	lang := strings.SplitN(acceptLanguage, ",", 2)[0]
+	lang = strings.SplitN(lang, ";", 2)[0]
+	lang = strings.SplitN(lang, "-", 2)[0]
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if len(lang) != 2 {
+		return defaultLanguage
+	}
+	for _, r := range lang {
+		if r < 'a' || r > 'z' {
+			return defaultLanguage
+		}
+	}
+	return lang
+}
+
+// newClientIPFunc returns a function that determines the client IP of a request.
+// Without a proxy header it's the remote address of the connection.
+// With a proxy header it's the rightmost IP in the header that's not a trusted proxy, because each proxy appends the address it received the request from,
+// while all entries to the left of the trusted proxies' entries can be set by the client.
+// If the remote address isn't a trusted proxy, the header is ignored.
+// An error is returned if one of the trusted proxies is neither an IP address nor a CIDR range.
+func newClientIPFunc(proxyHeader string, trustedProxies []string) (func(*fiber.Ctx) string, error) {
+	remoteIP := func(c *fiber.Ctx) string {
+		return c.Context().RemoteIP().String()
+	}
+	if proxyHeader == "" {
+		return remoteIP, nil
+	}
+
+	var trustedNets []*net.IPNet
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid trusted proxy: %w", err)
+		}
+		trustedNets = append(trustedNets, ipNet)
+	}
+	isTrusted := func(ip net.IP) bool {
+		for _, ipNet := range trustedNets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *fiber.Ctx) string {
+		ip := c.Context().RemoteIP()
+		if len(trustedNets) > 0 && !isTrusted(ip) {
+			return ip.String()
+		}
+		// For example "203.0.113.9, 10.0.0.1"
+		entries := strings.Split(c.Get(proxyHeader), ",")
+		for i := len(entries) - 1; i >= 0; i-- {
+			entryIP := net.ParseIP(strings.TrimSpace(entries[i]))
+			if entryIP == nil {
+				// Entries further to the left can't be trusted, so the last valid one has to do
+				break
+			}
+			ip = entryIP
+			if !isTrusted(ip) {
+				break
+			}
+		}
+		return ip.String()
+	}, nil
 }
@@ -0,0 +1,157 @@
+package stremio
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type testResult struct {
+	statusCode int
+	err        error
+}
+
+// testAsync sends the request to the app in a separate goroutine.
+// Errors are sent over the channel, because t.FailNow() must only be called from the test goroutine.
+func testAsync(app *fiber.App, req *http.Request) <-chan testResult {
+	done := make(chan testResult, 1)
+	go func() {
+		res, err := app.Test(req, -1)
+		if err != nil {
+			done <- testResult{err: err}
+			return
+		}
+		done <- testResult{statusCode: res.StatusCode}
+	}()
+	return done
+}
+
+func TestStreamLimitMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxGlobal  int
+		maxPerIP   int
+		statusCode int
+	}{
+		{name: "global", maxGlobal: 1, statusCode: fiber.StatusServiceUnavailable},
+		{name: "per IP", maxPerIP: 1, statusCode: fiber.StatusTooManyRequests},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Buffered for all requests of this test, so that only the first request blocks until released
+			started := make(chan struct{}, 3)
+			release := make(chan struct{})
+			app := fiber.New()
+			app.Use(createStreamLimitMiddleware(test.maxGlobal, test.maxPerIP, func(c *fiber.Ctx) string { return c.IP() }, zap.NewNop()))
+			app.Get("/", func(c *fiber.Ctx) error {
+				started <- struct{}{}
+				<-release
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			// First request occupies the only slot
+			done := testAsync(app, httptest.NewRequest("GET", "/", nil))
+			<-started
+
+			res, err := app.Test(httptest.NewRequest("GET", "/", nil), -1)
+			require.NoError(t, err)
+			require.Equal(t, test.statusCode, res.StatusCode)
+			require.Equal(t, "1", res.Header.Get(fiber.HeaderRetryAfter))
+
+			close(release)
+			result := <-done
+			require.NoError(t, result.err)
+			require.Equal(t, fiber.StatusOK, result.statusCode)
+
+			// The slot must be free again
+			res, err = app.Test(httptest.NewRequest("GET", "/", nil), -1)
+			require.NoError(t, err)
+			require.Equal(t, fiber.StatusOK, res.StatusCode)
+		})
+	}
+}
+
+func TestRequestLanguage(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		expected       string
+	}{
+		{acceptLanguage: "", expected: "en"},
+		{acceptLanguage: "*", expected: "en"},
+		{acceptLanguage: "de-DE,de;q=0.9", expected: "de"},
+		{acceptLanguage: "de;q=0.9,en;q=0.8", expected: "de"},
+		{acceptLanguage: "EN", expected: "en"},
+		{acceptLanguage: "zh-Hant", expected: "zh"},
+		{acceptLanguage: " fr , en", expected: "fr"},
+		{acceptLanguage: "english", expected: "en"},
+		{acceptLanguage: "1x", expected: "en"},
+		{acceptLanguage: ";;,,--", expected: "en"},
+	}
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(requestLanguage(c))
+	})
+	for _, test := range tests {
+		t.Run(test.acceptLanguage, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(fiber.HeaderAcceptLanguage, test.acceptLanguage)
+			res, err := app.Test(req)
+			require.NoError(t, err)
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, string(body))
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	// Requests via app.Test() come from 0.0.0.0
+	tests := []struct {
+		name           string
+		proxyHeader    string
+		trustedProxies []string
+		headerValue    string
+		expected       string
+	}{
+		{name: "no proxy header", headerValue: "203.0.113.1", expected: "0.0.0.0"},
+		{name: "all proxies trusted", proxyHeader: fiber.HeaderXForwardedFor, headerValue: "198.51.100.7, 203.0.113.1", expected: "203.0.113.1"},
+		{name: "single value header", proxyHeader: "X-Real-IP", trustedProxies: []string{"0.0.0.0"}, headerValue: "203.0.113.1", expected: "203.0.113.1"},
+		{name: "forged leftmost entry", proxyHeader: fiber.HeaderXForwardedFor, trustedProxies: []string{"0.0.0.0", "10.0.0.0/8"}, headerValue: "198.51.100.7, 203.0.113.1, 10.0.0.1", expected: "203.0.113.1"},
+		{name: "untrusted remote address", proxyHeader: fiber.HeaderXForwardedFor, trustedProxies: []string{"10.0.0.1"}, headerValue: "203.0.113.1", expected: "0.0.0.0"},
+		{name: "invalid entry", proxyHeader: fiber.HeaderXForwardedFor, trustedProxies: []string{"0.0.0.0", "10.0.0.0/8"}, headerValue: "203.0.113.1, foo, 10.0.0.1", expected: "10.0.0.1"},
+		{name: "missing header", proxyHeader: fiber.HeaderXForwardedFor, trustedProxies: []string{"0.0.0.0"}, expected: "0.0.0.0"},
+		{name: "IPv6", proxyHeader: fiber.HeaderXForwardedFor, trustedProxies: []string{"0.0.0.0", "fd00::/8"}, headerValue: "2001:db8::1, fd00::1", expected: "2001:db8::1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientIP, err := newClientIPFunc(test.proxyHeader, test.trustedProxies)
+			require.NoError(t, err)
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				return c.SendString(clientIP(c))
+			})
+			req := httptest.NewRequest("GET", "/", nil)
+			if test.headerValue != "" {
+				header := test.proxyHeader
+				if header == "" {
+					// Must be ignored
+					header = fiber.HeaderXForwardedFor
+				}
+				req.Header.Set(header, test.headerValue)
+			}
+			res, err := app.Test(req)
+			require.NoError(t, err)
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, string(body))
+		})
+	}
+
+	_, err := newClientIPFunc(fiber.HeaderXForwardedFor, []string{"foo"})
+	require.Error(t, err)
+}
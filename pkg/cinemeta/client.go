@@ -71,20 +71,22 @@ func NewClient(opts ClientOptions, cache Cache, logger *zap.Logger) *Client {
 
 // GetMovie returns the meta object either from the cache or from Cinemeta.
 // It automatically fills the cache with new Cinemeta responses.
+// The lang parameter is an ISO 639-1 language code like "en". Metas are cached per language.
 // The context can control the lifetime of the request, and if for example the timeout is shorter
 // than the HTTP client's configured timeout then it takes precedence.
 // If no timeout is set in the context, the HTTP client's timeout takes effect.
-func (c *Client) GetMovie(ctx context.Context, imdbID string) (Meta, error) {
-	return c.getMeta(ctx, movie, imdbID, 0, 0)
+func (c *Client) GetMovie(ctx context.Context, imdbID string, lang string) (Meta, error) {
+	return c.getMeta(ctx, movie, imdbID, 0, 0, lang)
 }
 
 // GetTVShow returns the meta object either from the cache or from Cinemeta.
 // It automatically fills the cache with new Cinemeta responses.
+// The lang parameter is an ISO 639-1 language code like "en". Metas are cached per language.
 // The context can control the lifetime of the request, and if for example the timeout is shorter
 // than the HTTP client's configured timeout then it takes precedence.
 // If no timeout is set in the context, the HTTP client's timeout takes effect.
-func (c *Client) GetTVShow(ctx context.Context, imdbID string, season int, episode int) (Meta, error) {
-	return c.getMeta(ctx, tvShow, imdbID, season, episode)
+func (c *Client) GetTVShow(ctx context.Context, imdbID string, season int, episode int, lang string) (Meta, error) {
+	return c.getMeta(ctx, tvShow, imdbID, season, episode, lang)
 }
 
 // GetMeta returns the meta object either from the cache or from Cinemeta.
@@ -92,7 +94,7 @@ func (c *Client) GetTVShow(ctx context.Context, imdbID string, season int, episo
 // The context can control the lifetime of the request, and if for example the timeout is shorter
 // than the HTTP client's configured timeout then it takes precedence.
 // If no timeout is set in the context, the HTTP client's timeout takes effect.
-func (c *Client) getMeta(ctx context.Context, t mediaType, imdbID string, season int, episode int) (Meta, error) {
+func (c *Client) getMeta(ctx context.Context, t mediaType, imdbID string, season int, episode int, lang string) (Meta, error) {
 	var zapFieldIMDbID zapcore.Field
 	switch t {
 	case movie:
@@ -102,7 +104,8 @@ func (c *Client) getMeta(ctx context.Context, t mediaType, imdbID string, season
 	}
 
 	// Check cache first
-	meta, created, found, err := c.cache.Get(imdbID)
+	key := cacheKey(imdbID, lang)
+	meta, created, found, err := c.cache.Get(key)
 	if err != nil {
 		c.logger.Error("Couldn't decode meta", zap.Error(err), zapFieldIMDbID)
 	} else if !found {
@@ -149,9 +152,15 @@ func (c *Client) getMeta(ctx context.Context, t mediaType, imdbID string, season
 	}
 
 	// Fill cache
-	if err = c.cache.Set(imdbID, cineRes.Meta); err != nil {
+	if err = c.cache.Set(key, cineRes.Meta); err != nil {
 		c.logger.Error("Couldn't cache meta", zap.Error(err), zap.String("meta", fmt.Sprintf("%+v", cineRes.Meta)), zapFieldIMDbID)
 	}
 
 	return cineRes.Meta, nil
 }
+
+// cacheKey returns the key for caching the meta of the given IMDb ID in the given language.
+// The language is part of the key so that the meta of one language is never returned for a request in another language.
+func cacheKey(imdbID, lang string) string {
+	return imdbID + ":" + lang
+}
@@ -0,0 +1,133 @@
+package stremio
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PreviewResolver resolves IDs to meta preview items.
+// When you set it in the options, your CatalogHandler can return "bare" MetaPreviewItem objects with only the ID set,
+// and the SDK enriches them via the resolver. This way many catalogs can share the same enrichment logic,
+// while the catalog handlers only decide *which* items a catalog contains.
+type PreviewResolver interface {
+	// ResolvePreviews returns meta preview items for the given IDs of the given type (like "movie"), mapped by ID.
+	// All bare items of a catalog response are resolved in a single call, and IDs that are in the SDK's cache aren't passed again.
+	// Items for IDs that are missing in the returned map are removed from the catalog response.
+	ResolvePreviews(ctx context.Context, t string, ids []string) (map[string]MetaPreviewItem, error)
+}
+
+// previewCacheMaxEntries limits the memory usage of the preview cache.
+const previewCacheMaxEntries = 100000
+
+type previewCacheItem struct {
+	preview MetaPreviewItem
+	created time.Time
+}
+
+// previewEnricher enriches bare meta preview items via a PreviewResolver and caches the results in memory.
+// It doesn't use the cinemeta.Cache interface, because that's specific to cinemeta.Meta objects, which lack some of the MetaPreviewItem fields like Links and Writer.
+type previewEnricher struct {
+	resolver PreviewResolver
+	cache    map[string]previewCacheItem
+	lock     *sync.RWMutex
+	ttl      time.Duration
+	logger   *zap.Logger
+}
+
+func newPreviewEnricher(resolver PreviewResolver, ttl time.Duration, logger *zap.Logger) *previewEnricher {
+	return &previewEnricher{
+		resolver: resolver,
+		cache:    map[string]previewCacheItem{},
+		lock:     &sync.RWMutex{},
+		ttl:      ttl,
+		logger:   logger,
+	}
+}
+
+// isBare returns true if the item only contains an ID, but no name, which every proper meta preview item has.
+func isBare(item MetaPreviewItem) bool {
+	return item.ID != "" && item.Name == ""
+}
+
+// enrich replaces bare items by the previews from the cache or resolver.
+// Items that are already complete are kept as they are.
+func (e *previewEnricher) enrich(ctx context.Context, t string, items []MetaPreviewItem) ([]MetaPreviewItem, error) {
+	// Collect IDs that aren't cached yet
+	previews := map[string]MetaPreviewItem{}
+	var uncachedIDs []string
+	e.lock.RLock()
+	for _, item := range items {
+		if !isBare(item) {
+			continue
+		}
+		if _, ok := previews[item.ID]; ok {
+			continue
+		}
+		if cacheItem, found := e.cache[t+":"+item.ID]; found && time.Since(cacheItem.created) <= e.ttl {
+			previews[item.ID] = cacheItem.preview
+		} else {
+			// Mark as seen to prevent duplicates
+			previews[item.ID] = MetaPreviewItem{}
+			uncachedIDs = append(uncachedIDs, item.ID)
+		}
+	}
+	e.lock.RUnlock()
+
+	// Resolve all uncached IDs in a single batch
+	if len(uncachedIDs) > 0 {
+		resolved, err := e.resolver.ResolvePreviews(ctx, t, uncachedIDs)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't resolve previews: %w", err)
+		}
+		now := time.Now()
+		e.lock.Lock()
+		for _, id := range uncachedIDs {
+			preview, ok := resolved[id]
+			if !ok {
+				delete(previews, id)
+				continue
+			}
+			if preview.Type == "" {
+				preview.Type = t
+			}
+			previews[id] = preview
+			e.setCacheItem(t+":"+id, preview, now)
+		}
+		e.lock.Unlock()
+	}
+
+	result := make([]MetaPreviewItem, 0, len(items))
+	for _, item := range items {
+		if !isBare(item) {
+			result = append(result, item)
+		} else if preview, ok := previews[item.ID]; ok {
+			result = append(result, preview)
+		} else {
+			e.logger.Debug("PreviewResolver didn't return a preview, removing item from the catalog", zap.String("id", item.ID))
+		}
+	}
+	return result, nil
+}
+
+// setCacheItem must only be called while holding the write lock.
+func (e *previewEnricher) setCacheItem(key string, preview MetaPreviewItem, now time.Time) {
+	if _, found := e.cache[key]; !found && len(e.cache) >= previewCacheMaxEntries {
+		for k, item := range e.cache {
+			if now.Sub(item.created) > e.ttl {
+				delete(e.cache, k)
+			}
+		}
+		// Still full, so the preview will be resolved again next time
+		if len(e.cache) >= previewCacheMaxEntries {
+			return
+		}
+	}
+	e.cache[key] = previewCacheItem{
+		preview: preview,
+		created: now,
+	}
+}
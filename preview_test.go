@@ -0,0 +1,87 @@
+package stremio
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakePreviewResolver struct {
+	calls [][]string
+}
+
+func (r *fakePreviewResolver) ResolvePreviews(ctx context.Context, t string, ids []string) (map[string]MetaPreviewItem, error) {
+	r.calls = append(r.calls, ids)
+	previews := map[string]MetaPreviewItem{}
+	for _, id := range ids {
+		if id != "unknown" {
+			previews[id] = MetaPreviewItem{ID: id, Name: "Name of " + id}
+		}
+	}
+	return previews, nil
+}
+
+func TestPreviewEnricher(t *testing.T) {
+	resolver := &fakePreviewResolver{}
+	enricher := newPreviewEnricher(resolver, time.Hour, zap.NewNop())
+
+	items := []MetaPreviewItem{
+		{ID: "a"},
+		{ID: "complete", Name: "Complete item"},
+		{ID: "unknown"},
+		{ID: "b"},
+		{ID: "a"},
+	}
+	result, err := enricher.enrich(context.Background(), "movie", items)
+	require.NoError(t, err)
+	require.Equal(t, []MetaPreviewItem{
+		{ID: "a", Type: "movie", Name: "Name of a"},
+		{ID: "complete", Name: "Complete item"},
+		{ID: "b", Type: "movie", Name: "Name of b"},
+		{ID: "a", Type: "movie", Name: "Name of a"},
+	}, result)
+	// All bare items in a single batch, without duplicates
+	require.Equal(t, [][]string{{"a", "unknown", "b"}}, resolver.calls)
+
+	// Cached items aren't resolved again
+	result, err = enricher.enrich(context.Background(), "movie", []MetaPreviewItem{{ID: "a"}, {ID: "c"}})
+	require.NoError(t, err)
+	require.Equal(t, []MetaPreviewItem{
+		{ID: "a", Type: "movie", Name: "Name of a"},
+		{ID: "c", Type: "movie", Name: "Name of c"},
+	}, result)
+	require.Equal(t, []string{"c"}, resolver.calls[1])
+
+	// The cache is per type
+	_, err = enricher.enrich(context.Background(), "series", []MetaPreviewItem{{ID: "a"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, resolver.calls[2])
+}
+
+func TestPreviewEnricherCacheLimit(t *testing.T) {
+	resolver := &fakePreviewResolver{}
+	enricher := newPreviewEnricher(resolver, time.Hour, zap.NewNop())
+
+	// A full cache with only fresh items doesn't accept new items, but the previews are still returned
+	for i := 0; i < previewCacheMaxEntries; i++ {
+		enricher.cache["movie:"+strconv.Itoa(i)] = previewCacheItem{created: time.Now()}
+	}
+	result, err := enricher.enrich(context.Background(), "movie", []MetaPreviewItem{{ID: "a"}})
+	require.NoError(t, err)
+	require.Equal(t, []MetaPreviewItem{{ID: "a", Type: "movie", Name: "Name of a"}}, result)
+	require.Len(t, enricher.cache, previewCacheMaxEntries)
+	require.NotContains(t, enricher.cache, "movie:a")
+
+	// Expired items are removed to make room
+	for i := 0; i < previewCacheMaxEntries/2; i++ {
+		enricher.cache["movie:"+strconv.Itoa(i)] = previewCacheItem{created: time.Now().Add(-2 * time.Hour)}
+	}
+	_, err = enricher.enrich(context.Background(), "movie", []MetaPreviewItem{{ID: "a"}})
+	require.NoError(t, err)
+	require.Len(t, enricher.cache, previewCacheMaxEntries/2+1)
+	require.Contains(t, enricher.cache, "movie:a")
+}
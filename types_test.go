@@ -1,6 +1,7 @@
 package stremio
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -118,3 +119,46 @@ func TestManifestClone(t *testing.T) {
 		})
 	}
 }
+
+func TestManifestBehaviorHints(t *testing.T) {
+	// Based on the example manifest in the Stremio addon SDK docs, with the manifest-level behavior hints that Stremio accepts.
+	stremioManifest := `{
+		"id": "org.stremio.example",
+		"version": "1.0.0",
+		"name": "Example addon",
+		"description": "Example addon with behavior hints",
+		"resources": [{"name": "stream", "types": ["movie"], "idPrefixes": ["tt"]}],
+		"types": ["movie"],
+		"catalogs": [],
+		"behaviorHints": {
+			"adult": true,
+			"p2p": true,
+			"configurable": true,
+			"configurationRequired": true
+		}
+	}`
+
+	var m Manifest
+	err := json.Unmarshal([]byte(stremioManifest), &m)
+	require.NoError(t, err)
+	require.Equal(t, BehaviorHints{
+		Adult:                 true,
+		P2P:                   true,
+		Configurable:          true,
+		ConfigurationRequired: true,
+	}, m.BehaviorHints)
+
+	// Round trip
+	manifestJSON, err := json.Marshal(m)
+	require.NoError(t, err)
+	require.JSONEq(t, stremioManifest, string(manifestJSON))
+
+	// Unset hints must be omitted
+	m.BehaviorHints = BehaviorHints{P2P: true}
+	manifestJSON, err = json.Marshal(m)
+	require.NoError(t, err)
+	var raw map[string]json.RawMessage
+	err = json.Unmarshal(manifestJSON, &raw)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"p2p": true}`, string(raw["behaviorHints"]))
+}